@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPProfile is a named set of send credentials a tenant can send through,
+// referenced by ID from a send request instead of raw credentials. Host,
+// Port, Username and Password configure the net/smtp transport; the other
+// fields configure whichever provider Transport names.
+type SMTPProfile struct {
+	ID       string `json:"id"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Transport selects the delivery backend (TransportSMTP, TransportSES,
+	// TransportSendGrid, TransportMailgun, TransportSendmail). Empty means
+	// fall back to the EMAIL_TRANSPORT environment variable, then
+	// TransportSMTP.
+	Transport string `json:"transport,omitempty"`
+	// APIKey authenticates with SendGrid or Mailgun.
+	APIKey string `json:"api_key,omitempty"`
+	// Domain is the Mailgun sending domain.
+	Domain string `json:"domain,omitempty"`
+	// Region is the AWS region SES requests are sent to.
+	Region string `json:"region,omitempty"`
+	// SendmailPath overrides the local sendmail-compatible binary to exec.
+	SendmailPath string `json:"sendmail_path,omitempty"`
+
+	// DKIMPrivateKeyPath, if set, signs outgoing mail with the PEM-encoded
+	// RSA or Ed25519 private key at this path.
+	DKIMPrivateKeyPath string `json:"dkim_private_key_path,omitempty"`
+	// DKIMSelector is the DKIM selector (the "s=" tag); defaults to
+	// "default".
+	DKIMSelector string `json:"dkim_selector,omitempty"`
+	// DKIMDomain is the signing domain (the "d=" tag); defaults to the
+	// domain of the From address.
+	DKIMDomain string `json:"dkim_domain,omitempty"`
+	// ReturnPath overrides the envelope Return-Path header; defaults to the
+	// From address.
+	ReturnPath string `json:"return_path,omitempty"`
+}
+
+// RateLimitConfig bounds how much a tenant can send.
+type RateLimitConfig struct {
+	RequestsPerMinute int `json:"requests_per_minute"`
+	EmailsPerDay      int `json:"emails_per_day"`
+}
+
+// Tenant is an API consumer: an API key, the SMTP profiles it may send
+// through, which From addresses it may use, and its rate limits.
+type Tenant struct {
+	ID              string                 `json:"id"`
+	APIKey          string                 `json:"api_key"`
+	Profiles        map[string]SMTPProfile `json:"profiles"`
+	SenderAllowlist []string               `json:"sender_allowlist"`
+	RateLimit       RateLimitConfig        `json:"rate_limit"`
+
+	requestBucket *tokenBucket
+	emailBucket   *tokenBucket
+}
+
+// tokenBucket is a simple token-bucket rate limiter refilled continuously
+// based on elapsed wall-clock time.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	tokens   float64
+	refill   float64 // tokens added per second
+	last     time.Time
+}
+
+func newTokenBucket(capacity float64, refillPerSecond float64) *tokenBucket {
+	return &tokenBucket{
+		capacity: capacity,
+		tokens:   capacity,
+		refill:   refillPerSecond,
+		last:     time.Now(),
+	}
+}
+
+// Allow consumes a token if one is available.
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(b.last).Seconds()
+	b.last = now
+
+	b.tokens += elapsed * b.refill
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// isSenderAllowed reports whether from is permitted for this tenant. An
+// empty allowlist permits any sender.
+func (t *Tenant) isSenderAllowed(from string) bool {
+	if len(t.SenderAllowlist) == 0 {
+		return true
+	}
+	for _, allowed := range t.SenderAllowlist {
+		if strings.EqualFold(allowed, from) {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantStore holds the configured tenants, keyed by API key.
+type TenantStore struct {
+	byAPIKey map[string]*Tenant
+}
+
+// LoadTenantStore reads a JSON array of tenants from path and initializes
+// each tenant's rate limit buckets.
+func LoadTenantStore(path string) (*TenantStore, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tenants []*Tenant
+	if err := json.Unmarshal(raw, &tenants); err != nil {
+		return nil, err
+	}
+
+	store := &TenantStore{byAPIKey: make(map[string]*Tenant, len(tenants))}
+	for _, t := range tenants {
+		if t.RateLimit.RequestsPerMinute <= 0 {
+			t.RateLimit.RequestsPerMinute = 60
+		}
+		if t.RateLimit.EmailsPerDay <= 0 {
+			t.RateLimit.EmailsPerDay = 1000
+		}
+		t.requestBucket = newTokenBucket(float64(t.RateLimit.RequestsPerMinute), float64(t.RateLimit.RequestsPerMinute)/60)
+		t.emailBucket = newTokenBucket(float64(t.RateLimit.EmailsPerDay), float64(t.RateLimit.EmailsPerDay)/86400)
+		store.byAPIKey[t.APIKey] = t
+	}
+
+	return store, nil
+}
+
+func (s *TenantStore) lookup(apiKey string) (*Tenant, bool) {
+	t, ok := s.byAPIKey[apiKey]
+	return t, ok
+}
+
+type tenantContextKey struct{}
+
+// Authenticate extracts a bearer token from the Authorization header, looks
+// up the corresponding tenant, and rejects the request if it's missing,
+// unknown, or over its per-minute rate limit.
+func (s *TenantStore) Authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		apiKey := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if apiKey == "" || apiKey == r.Header.Get("Authorization") {
+			http.Error(w, "Missing or malformed Authorization header", http.StatusUnauthorized)
+			return
+		}
+
+		tenant, ok := s.lookup(apiKey)
+		if !ok {
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		if !tenant.requestBucket.Allow() {
+			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), tenantContextKey{}, tenant)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// tenantFromContext retrieves the authenticated tenant set by Authenticate.
+func tenantFromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(*Tenant)
+	return tenant, ok
+}
+
+func tenantStorePath() string {
+	if path := os.Getenv("TENANTS_CONFIG_PATH"); path != "" {
+		return path
+	}
+	return "./tenants.json"
+}
+
+// maxEmailBodyBytes caps how large a rendered email body may be, configurable
+// via MAX_EMAIL_BODY_BYTES.
+func maxEmailBodyBytes() int {
+	if v := os.Getenv("MAX_EMAIL_BODY_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 512 * 1024
+}
+
+// auditSend logs a structured record of every send attempt, successful or
+// not, for later audit.
+func auditSend(tenantID, to, profileID string, err error) {
+	status := "queued"
+	if err != nil {
+		status = "rejected"
+	}
+	if err != nil {
+		log.Printf("audit tenant=%s to=%s profile=%s status=%s error=%q", tenantID, to, profileID, status, err)
+		return
+	}
+	log.Printf("audit tenant=%s to=%s profile=%s status=%s", tenantID, to, profileID, status)
+}
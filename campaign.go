@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// CampaignRecipient is a single recipient of a campaign, along with the
+// placeholder data used to render their copy of the template.
+type CampaignRecipient struct {
+	Email string                 `json:"email"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+	RId   string                 `json:"rid,omitempty"`
+}
+
+// CampaignRequest is the body of POST /campaign.
+type CampaignRequest struct {
+	Name        string              `json:"name"`
+	Subject     string              `json:"subject"`
+	Template    string              `json:"template"`
+	TrackingURL string              `json:"tracking_url"`
+	Recipients  []CampaignRecipient `json:"recipients"`
+	// From overrides the service's default sender address; must be on the
+	// authenticated tenant's sender allowlist, same as POST /send.
+	From string `json:"from,omitempty"`
+}
+
+// CampaignStats is the summary returned by GET /campaign/{id}/stats.
+type CampaignStats struct {
+	ID      string `json:"id"`
+	Sent    int    `json:"sent"`
+	Opened  int    `json:"opened"`
+	Clicked int    `json:"clicked"`
+}
+
+// CampaignStore persists send/open/click events for campaigns. The default
+// implementation is backed by BoltDB; a SQLite-backed implementation can
+// satisfy the same interface without touching the campaign manager.
+type CampaignStore interface {
+	RecordCampaign(campaignID, tenantID string) error
+	Owner(campaignID string) (string, error)
+	RecordSend(campaignID, rid string) error
+	RecordOpen(campaignID, rid string) error
+	RecordClick(campaignID, rid, targetURL string) error
+	Stats(campaignID string) (CampaignStats, error)
+}
+
+var (
+	ownerBucket   = []byte("owner")
+	sentBucket    = []byte("sent")
+	openedBucket  = []byte("opened")
+	clickedBucket = []byte("clicked")
+)
+
+// BoltCampaignStore is a CampaignStore backed by a BoltDB file. Each event is
+// stored under a bucket per event type with key "campaignID:rid" (value "1",
+// or the target URL for clicks), so
+// Stats can report distinct counts per campaign with a simple prefix scan.
+type BoltCampaignStore struct {
+	db *bbolt.DB
+}
+
+func NewBoltCampaignStore(path string) (*BoltCampaignStore, error) {
+	db, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open campaign store: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{ownerBucket, sentBucket, openedBucket, clickedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to init campaign store buckets: %w", err)
+	}
+
+	return &BoltCampaignStore{db: db}, nil
+}
+
+func eventKey(campaignID, rid string) []byte {
+	return []byte(campaignID + ":" + rid)
+}
+
+func (s *BoltCampaignStore) record(bucket []byte, campaignID, rid string, value []byte) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put(eventKey(campaignID, rid), value)
+	})
+}
+
+// RecordCampaign records the tenant that created campaignID, so later stats
+// requests can be scoped to that tenant via Owner.
+func (s *BoltCampaignStore) RecordCampaign(campaignID, tenantID string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(ownerBucket).Put([]byte(campaignID), []byte(tenantID))
+	})
+}
+
+// Owner returns the tenant ID that created campaignID, or "" if unknown.
+func (s *BoltCampaignStore) Owner(campaignID string) (string, error) {
+	var tenantID string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		tenantID = string(tx.Bucket(ownerBucket).Get([]byte(campaignID)))
+		return nil
+	})
+	return tenantID, err
+}
+
+func (s *BoltCampaignStore) RecordSend(campaignID, rid string) error {
+	return s.record(sentBucket, campaignID, rid, []byte("1"))
+}
+
+func (s *BoltCampaignStore) RecordOpen(campaignID, rid string) error {
+	return s.record(openedBucket, campaignID, rid, []byte("1"))
+}
+
+func (s *BoltCampaignStore) RecordClick(campaignID, rid, targetURL string) error {
+	return s.record(clickedBucket, campaignID, rid, []byte(targetURL))
+}
+
+func (s *BoltCampaignStore) Stats(campaignID string) (CampaignStats, error) {
+	stats := CampaignStats{ID: campaignID}
+	prefix := []byte(campaignID + ":")
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		counts := []struct {
+			bucket []byte
+			count  *int
+		}{
+			{sentBucket, &stats.Sent},
+			{openedBucket, &stats.Opened},
+			{clickedBucket, &stats.Clicked},
+		}
+		for _, c := range counts {
+			cur := tx.Bucket(c.bucket).Cursor()
+			for k, _ := cur.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = cur.Next() {
+				*c.count++
+			}
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+func hasPrefix(b, prefix []byte) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == string(prefix)
+}
+
+// CampaignManager renders per-recipient campaign emails, fans them out onto
+// the shared EmailService worker pool, and records send/open/click events.
+type CampaignManager struct {
+	emailService *EmailService
+	store        CampaignStore
+}
+
+func NewCampaignManager(emailService *EmailService, store CampaignStore) *CampaignManager {
+	return &CampaignManager{emailService: emailService, store: store}
+}
+
+func campaignStorePath() string {
+	if path := os.Getenv("CAMPAIGN_DB_PATH"); path != "" {
+		return path
+	}
+	return "./campaigns.db"
+}
+
+func newCampaignID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// renderCampaignEmail renders tmplText for a single recipient, merging their
+// placeholder data with RId, then appends a tracking pixel and rewrites any
+// "URL" field into a click-tracked redirect through /click.
+func renderCampaignEmail(tmplText, trackingURL, campaignID string, rec CampaignRecipient) (string, error) {
+	tmpl, err := template.New("campaign").Parse(tmplText)
+	if err != nil {
+		return "", fmt.Errorf("invalid campaign template: %w", err)
+	}
+
+	data := make(map[string]interface{}, len(rec.Data)+1)
+	for k, v := range rec.Data {
+		data[k] = v
+	}
+	data["RId"] = rec.RId
+
+	if target, ok := data["URL"]; ok {
+		data["URL"] = fmt.Sprintf("%s/click?cid=%s&rid=%s&url=%s",
+			trackingURL, url.QueryEscape(campaignID), url.QueryEscape(rec.RId), url.QueryEscape(fmt.Sprintf("%v", target)))
+	}
+
+	var bodyBuf bytes.Buffer
+	if err := tmpl.Execute(&bodyBuf, data); err != nil {
+		return "", fmt.Errorf("failed to render campaign template: %w", err)
+	}
+
+	pixel := fmt.Sprintf(`<img src="%s/track?cid=%s&rid=%s" width="1" height="1" alt="" style="display:none" />`,
+		trackingURL, url.QueryEscape(campaignID), url.QueryEscape(rec.RId))
+
+	return bodyBuf.String() + pixel, nil
+}
+
+// handleCreateCampaign is registered behind tenants.Authenticate: every
+// recipient is sent as the authenticated tenant, so its email-per-day rate
+// limit and sender allowlist both apply exactly as they do to POST /send.
+func (m *CampaignManager) handleCreateCampaign(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
+	var req CampaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Template == "" {
+		http.Error(w, "Missing 'template' field", http.StatusBadRequest)
+		return
+	}
+	if len(req.Recipients) == 0 {
+		http.Error(w, "Missing 'recipients' field", http.StatusBadRequest)
+		return
+	}
+	if req.From != "" && !tenant.isSenderAllowed(req.From) {
+		http.Error(w, "Sender address not allowed for this tenant", http.StatusForbidden)
+		return
+	}
+
+	campaignID, err := newCampaignID()
+	if err != nil {
+		http.Error(w, "Failed to generate campaign id", http.StatusInternalServerError)
+		return
+	}
+	if err := m.store.RecordCampaign(campaignID, tenant.ID); err != nil {
+		http.Error(w, "Failed to record campaign", http.StatusInternalServerError)
+		return
+	}
+
+	queued := 0
+	for i, rec := range req.Recipients {
+		if rec.RId == "" {
+			rec.RId = fmt.Sprintf("%s-%d", campaignID, i)
+		}
+
+		if _, err := mail.ParseAddress(rec.Email); err != nil {
+			continue
+		}
+
+		if !tenant.emailBucket.Allow() {
+			continue
+		}
+
+		body, err := renderCampaignEmail(req.Template, req.TrackingURL, campaignID, rec)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		emailData := EmailData{
+			To:      rec.Email,
+			From:    req.From,
+			Subject: req.Subject,
+			Body:    body,
+			Data:    rec.Data,
+		}
+		err = m.emailService.QueueEmail(emailData, tenant.ID)
+		auditSend(tenant.ID, rec.Email, "", err)
+		if err != nil {
+			continue
+		}
+		if err := m.store.RecordSend(campaignID, rec.RId); err != nil {
+			continue
+		}
+		queued++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      "success",
+		"campaign_id": campaignID,
+		"queued":      queued,
+	})
+}
+
+// transparentPixelGIF is a 1x1 transparent GIF served in response to open
+// tracking requests.
+var transparentPixelGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
+	0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+func (m *CampaignManager) handleTrackOpen(w http.ResponseWriter, r *http.Request) {
+	campaignID := r.URL.Query().Get("cid")
+	rid := r.URL.Query().Get("rid")
+	if campaignID != "" && rid != "" {
+		m.store.RecordOpen(campaignID, rid)
+	}
+
+	w.Header().Set("Content-Type", "image/gif")
+	w.Write(transparentPixelGIF)
+}
+
+// campaignRedirectAllowedHosts returns the optional click-tracking redirect
+// host allowlist, configured via CAMPAIGN_REDIRECT_ALLOWED_HOSTS as a
+// comma-separated list. An empty list means any http(s) host is allowed.
+func campaignRedirectAllowedHosts() []string {
+	raw := os.Getenv("CAMPAIGN_REDIRECT_ALLOWED_HOSTS")
+	if raw == "" {
+		return nil
+	}
+
+	var hosts []string
+	for _, h := range strings.Split(raw, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// isAllowedRedirectTarget reports whether target is safe to redirect a
+// click-tracking request to: an absolute http(s) URL with a host, matching
+// the configured allowlist if one is set.
+func isAllowedRedirectTarget(target string) bool {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	allowed := campaignRedirectAllowedHosts()
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, h := range allowed {
+		if strings.EqualFold(h, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *CampaignManager) handleTrackClick(w http.ResponseWriter, r *http.Request) {
+	campaignID := r.URL.Query().Get("cid")
+	rid := r.URL.Query().Get("rid")
+	target := r.URL.Query().Get("url")
+
+	if target == "" {
+		http.Error(w, "Missing 'url' parameter", http.StatusBadRequest)
+		return
+	}
+	if !isAllowedRedirectTarget(target) {
+		http.Error(w, "Redirect target not allowed", http.StatusBadRequest)
+		return
+	}
+	if campaignID != "" && rid != "" {
+		m.store.RecordClick(campaignID, rid, target)
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func (m *CampaignManager) handleCampaignStats(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
+	campaignID := r.PathValue("id")
+	if campaignID == "" {
+		http.Error(w, "Missing campaign id", http.StatusBadRequest)
+		return
+	}
+
+	owner, err := m.store.Owner(campaignID)
+	if err != nil {
+		http.Error(w, "Failed to load campaign stats", http.StatusInternalServerError)
+		return
+	}
+	if owner == "" || owner != tenant.ID {
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := m.store.Stats(campaignID)
+	if err != nil {
+		http.Error(w, "Failed to load campaign stats", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsAllowedRedirectTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		want   bool
+	}{
+		{"valid https url", "https://example.com/landing", true},
+		{"valid http url", "http://example.com/landing", true},
+		{"no scheme", "example.com/landing", false},
+		{"unsupported scheme", "javascript:alert(1)", false},
+		{"no host", "https:///landing", false},
+		{"malformed url", "https://[::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isAllowedRedirectTarget(tt.target); got != tt.want {
+			t.Errorf("%s: isAllowedRedirectTarget(%q) = %v, want %v", tt.name, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestIsAllowedRedirectTargetWithAllowlist(t *testing.T) {
+	t.Setenv("CAMPAIGN_REDIRECT_ALLOWED_HOSTS", "example.com, trusted.example.org")
+
+	if !isAllowedRedirectTarget("https://example.com/landing") {
+		t.Error("expected allowlisted host to be allowed")
+	}
+	if !isAllowedRedirectTarget("https://TRUSTED.example.org/path") {
+		t.Error("expected allowlist match to be case-insensitive")
+	}
+	if isAllowedRedirectTarget("https://attacker.example.net/phish") {
+		t.Error("expected non-allowlisted host to be rejected")
+	}
+}
+
+func TestRenderCampaignEmail(t *testing.T) {
+	rec := CampaignRecipient{
+		Email: "user@example.com",
+		RId:   "r1",
+		Data:  map[string]interface{}{"Name": "Ada", "URL": "https://example.com/offer"},
+	}
+
+	body, err := renderCampaignEmail("Hi {{.Name}}, see {{.URL}}", "https://track.example.com", "camp1", rec)
+	if err != nil {
+		t.Fatalf("renderCampaignEmail returned error: %v", err)
+	}
+
+	if !strings.Contains(body, "Hi Ada") {
+		t.Errorf("expected rendered body to include recipient data, got %q", body)
+	}
+	if !strings.Contains(body, "https://track.example.com/click?cid=camp1&amp;rid=r1") {
+		t.Errorf("expected rendered body to rewrite URL into a click-tracked link, got %q", body)
+	}
+	if !strings.Contains(body, `track.example.com/track?cid=camp1&rid=r1`) {
+		t.Errorf("expected rendered body to include an open-tracking pixel, got %q", body)
+	}
+}
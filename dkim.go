@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
+
+	"github.com/emersion/go-msgauth/dkim"
+)
+
+// defaultDKIMSelector is used when a profile doesn't set DKIMSelector.
+const defaultDKIMSelector = "default"
+
+// dkimSignedHeaders is the canonical set of headers covered by the
+// DKIM-Signature, chosen to satisfy DMARC alignment checks on most
+// receivers.
+var dkimSignedHeaders = []string{"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type"}
+
+// signDKIM signs message with the RSA or Ed25519 private key at keyPath,
+// returning message with a DKIM-Signature header prepended.
+func signDKIM(message []byte, domain, selector, keyPath string) ([]byte, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DKIM private key: %w", err)
+	}
+
+	signer, err := parseDKIMPrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DKIM private key: %w", err)
+	}
+
+	options := &dkim.SignOptions{
+		Domain:                 domain,
+		Selector:               selector,
+		Signer:                 signer,
+		HeaderCanonicalization: dkim.CanonicalizationRelaxed,
+		BodyCanonicalization:   dkim.CanonicalizationRelaxed,
+		HeaderKeys:             dkimSignedHeaders,
+	}
+
+	var signed bytes.Buffer
+	if err := dkim.Sign(&signed, bytes.NewReader(message), options); err != nil {
+		return nil, fmt.Errorf("failed to sign message: %w", err)
+	}
+	return signed.Bytes(), nil
+}
+
+// parseDKIMPrivateKey parses a PEM-encoded RSA key (PKCS#1 or PKCS#8) or
+// Ed25519 key (PKCS#8).
+func parseDKIMPrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported DKIM private key type %T", key)
+	}
+	return signer, nil
+}
+
+// dkimDNSRecord renders the TXT record value operators publish at
+// <selector>._domainkey.<domain> for the public half of keyPEM.
+func dkimDNSRecord(keyPEM []byte) (string, error) {
+	signer, err := parseDKIMPrivateKey(keyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal RSA public key: %w", err)
+		}
+		return fmt.Sprintf("v=DKIM1; k=rsa; p=%s", base64.StdEncoding.EncodeToString(der)), nil
+	case ed25519.PublicKey:
+		return fmt.Sprintf("v=DKIM1; k=ed25519; p=%s", base64.StdEncoding.EncodeToString(pub)), nil
+	default:
+		return "", fmt.Errorf("unsupported DKIM public key type %T", pub)
+	}
+}
+
+// dkimKeysDir is where handleDKIMDNSRecord looks up private keys, as
+// <dir>/<domain>/<selector>.pem, configurable via DKIM_KEYS_DIR.
+func dkimKeysDir() string {
+	if dir := os.Getenv("DKIM_KEYS_DIR"); dir != "" {
+		return dir
+	}
+	return "./dkim"
+}
+
+// handleDKIMDNSRecord prints the DNS TXT record an operator needs to
+// publish for a signing domain and selector (?selector=, default
+// "default"), so outgoing mail signed with signDKIM passes verification.
+func handleDKIMDNSRecord(w http.ResponseWriter, r *http.Request) {
+	domain := r.PathValue("domain")
+	if domain == "" {
+		http.Error(w, "Missing domain", http.StatusBadRequest)
+		return
+	}
+
+	selector := r.URL.Query().Get("selector")
+	if selector == "" {
+		selector = defaultDKIMSelector
+	}
+
+	keyPath := filepath.Join(dkimKeysDir(), domain, selector+".pem")
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read DKIM key for %s/%s: %v", domain, selector, err), http.StatusNotFound)
+		return
+	}
+
+	record, err := dkimDNSRecord(keyPEM)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to derive DNS record: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s._domainkey.%s IN TXT \"%s\"\n", selector, domain, record)
+}
+
+// newMessageID generates an RFC 5322 Message-Id value scoped to domain.
+func newMessageID(domain string) (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	if domain == "" {
+		domain = "localhost"
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(buf), domain), nil
+}
+
+// domainFromAddress extracts the domain half of an email address, which may
+// be in either "user@domain" or "Display Name <user@domain>" form. It
+// returns "" if addr doesn't parse.
+func domainFromAddress(addr string) string {
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil {
+		return ""
+	}
+	at := -1
+	for i := len(parsed.Address) - 1; i >= 0; i-- {
+		if parsed.Address[i] == '@' {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		return ""
+	}
+	return parsed.Address[at+1:]
+}
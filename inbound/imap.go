@@ -0,0 +1,132 @@
+package inbound
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// IMAPConfig configures polling a mailbox for inbound mail instead of
+// running an SMTP server directly.
+type IMAPConfig struct {
+	Addr          string
+	Username      string
+	Password      string
+	Mailbox       string
+	PollInterval  time.Duration
+	WebhookURL    string
+	WebhookSecret string
+}
+
+// IMAPPoller periodically fetches and forwards unseen messages from an IMAP
+// mailbox, marking each as seen once it has been forwarded.
+type IMAPPoller struct {
+	cfg  IMAPConfig
+	stop chan struct{}
+}
+
+func NewIMAPPoller(cfg IMAPConfig) *IMAPPoller {
+	if cfg.Mailbox == "" {
+		cfg.Mailbox = "INBOX"
+	}
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	return &IMAPPoller{cfg: cfg, stop: make(chan struct{})}
+}
+
+// Start blocks, polling on cfg.PollInterval until Stop is called.
+func (p *IMAPPoller) Start() error {
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.pollOnce(); err != nil {
+				log.Printf("IMAP poll failed: %v", err)
+			}
+		case <-p.stop:
+			return nil
+		}
+	}
+}
+
+func (p *IMAPPoller) Stop() {
+	close(p.stop)
+}
+
+func (p *IMAPPoller) pollOnce() error {
+	client, err := imapclient.DialTLS(p.cfg.Addr, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to IMAP server: %w", err)
+	}
+	defer client.Close()
+
+	if err := client.Login(p.cfg.Username, p.cfg.Password).Wait(); err != nil {
+		return fmt.Errorf("failed to authenticate to IMAP server: %w", err)
+	}
+
+	if _, err := client.Select(p.cfg.Mailbox, nil).Wait(); err != nil {
+		return fmt.Errorf("failed to select mailbox %s: %w", p.cfg.Mailbox, err)
+	}
+
+	criteria := &imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}
+	searchData, err := client.Search(criteria, nil).Wait()
+	if err != nil {
+		return fmt.Errorf("failed to search for unseen messages: %w", err)
+	}
+
+	for _, seqNum := range searchData.AllSeqNums() {
+		if err := p.forwardMessage(client, seqNum); err != nil {
+			log.Printf("Failed to forward IMAP message %d: %v", seqNum, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *IMAPPoller) forwardMessage(client *imapclient.Client, seqNum uint32) error {
+	seqSet := imap.SeqSetNum(seqNum)
+	fetchOptions := &imap.FetchOptions{BodySection: []*imap.FetchItemBodySection{{Peek: true}}}
+
+	fetchCmd := client.Fetch(seqSet, fetchOptions)
+	defer fetchCmd.Close()
+
+	msg := fetchCmd.Next()
+	if msg == nil {
+		return fmt.Errorf("message %d not found", seqNum)
+	}
+
+	var raw bytes.Buffer
+	for {
+		item := msg.Next()
+		if item == nil {
+			break
+		}
+		if section, ok := item.(imapclient.FetchItemDataBodySection); ok {
+			if _, err := raw.ReadFrom(section.Literal); err != nil {
+				return err
+			}
+		}
+	}
+
+	parsed, err := ParseMessage("", p.cfg.Username, &raw)
+	if err != nil {
+		return err
+	}
+
+	if p.cfg.WebhookURL == "" {
+		return nil
+	}
+	if err := DeliverWebhook(p.cfg.WebhookURL, p.cfg.WebhookSecret, parsed); err != nil {
+		return err
+	}
+
+	storeFlags := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagSeen}}
+	return client.Store(seqSet, storeFlags, nil).Close()
+}
@@ -0,0 +1,194 @@
+// Package inbound implements a mail-receiving subsystem that runs alongside
+// the outbound EmailService: it accepts mail over SMTP or IMAP, normalizes
+// it, and forwards it to a user-configured webhook.
+package inbound
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+)
+
+// Attachment is a file extracted from an inbound message.
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+}
+
+// Message is the normalized form of an inbound email, forwarded to the
+// configured webhook as JSON.
+type Message struct {
+	From        string            `json:"from"`
+	To          string            `json:"to"`
+	Subject     string            `json:"subject"`
+	Text        string            `json:"text"`
+	HTML        string            `json:"html"`
+	Attachments []Attachment      `json:"attachments"`
+	Headers     map[string]string `json:"headers"`
+}
+
+// ParseMessage parses a raw RFC 5322 message (as delivered over SMTP DATA or
+// fetched from IMAP) into a normalized Message. The envelope from/to, which
+// SMTP carries out-of-band from MAIL FROM/RCPT TO, are passed in separately.
+func ParseMessage(envelopeFrom, envelopeTo string, r io.Reader) (*Message, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	headers := make(map[string]string, len(msg.Header))
+	for k := range msg.Header {
+		headers[k] = msg.Header.Get(k)
+	}
+
+	out := &Message{
+		From:    envelopeFrom,
+		To:      envelopeTo,
+		Subject: msg.Header.Get("Subject"),
+		Headers: headers,
+	}
+
+	contentType := msg.Header.Get("Content-Type")
+	if contentType == "" {
+		body, err := io.ReadAll(msg.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read message body: %w", err)
+		}
+		out.Text = string(body)
+		return out, nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Content-Type: %w", err)
+	}
+
+	if err := collectParts(out, mediaType, params, msg.Body); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// collectParts fills out.Text, out.HTML, and out.Attachments by walking a
+// (possibly nested) multipart body.
+func collectParts(out *Message, mediaType string, params map[string]string, body io.Reader) error {
+	if !isMultipart(mediaType) {
+		content, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		switch mediaType {
+		case "text/plain":
+			out.Text = string(content)
+		case "text/html":
+			out.HTML = string(content)
+		}
+		return nil
+	}
+
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read multipart body: %w", err)
+		}
+
+		if err := collectPart(out, part); err != nil {
+			return err
+		}
+	}
+}
+
+func isMultipart(mediaType string) bool {
+	return len(mediaType) >= 10 && mediaType[:10] == "multipart/"
+}
+
+func collectPart(out *Message, part *multipart.Part) error {
+	defer part.Close()
+
+	partContentType := part.Header.Get("Content-Type")
+	if partContentType == "" {
+		partContentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(partContentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	filename := part.FileName()
+	if filename != "" {
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+		out.Attachments = append(out.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: mediaType,
+			Content:     content,
+		})
+		return nil
+	}
+
+	if isMultipart(mediaType) {
+		return collectParts(out, mediaType, params, part)
+	}
+
+	content, err := io.ReadAll(part)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case "text/plain":
+		out.Text = string(content)
+	case "text/html":
+		out.HTML = string(content)
+	}
+	return nil
+}
+
+// DeliverWebhook POSTs a Message as JSON to url, signing the body with
+// HMAC-SHA256 under the X-Webhook-Signature header so the receiver can
+// verify it came from this service.
+func DeliverWebhook(url, secret string, msg *Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inbound message: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Signature", signPayload(secret, payload))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,119 @@
+package inbound
+
+import (
+	"io"
+	"log"
+	"regexp"
+
+	gosmtp "github.com/emersion/go-smtp"
+)
+
+// Config configures the inbound mail subsystem.
+type Config struct {
+	// ListenAddr is the address the SMTP server listens on, e.g. ":2525".
+	ListenAddr string
+	// Domain is advertised in the SMTP greeting.
+	Domain string
+	// RecipientPattern, if set, restricts RCPT TO to addresses it matches;
+	// unknown recipients are rejected at RCPT TO time.
+	RecipientPattern *regexp.Regexp
+	// WebhookURL receives a normalized JSON payload for every accepted
+	// message.
+	WebhookURL string
+	// WebhookSecret signs the webhook body via HMAC-SHA256.
+	WebhookSecret string
+}
+
+// Server receives inbound mail over SMTP and forwards it to a webhook.
+type Server struct {
+	cfg    Config
+	server *gosmtp.Server
+}
+
+// NewServer builds a Server ready to Start.
+func NewServer(cfg Config) *Server {
+	s := &Server{cfg: cfg}
+
+	backend := &backend{cfg: cfg}
+	smtpServer := gosmtp.NewServer(backend)
+	smtpServer.Addr = cfg.ListenAddr
+	smtpServer.Domain = cfg.Domain
+	smtpServer.AllowInsecureAuth = true
+
+	s.server = smtpServer
+	return s
+}
+
+// Start blocks serving SMTP connections until the listener errors or Stop is
+// called.
+func (s *Server) Start() error {
+	log.Printf("Inbound SMTP server listening on %s", s.cfg.ListenAddr)
+	return s.server.ListenAndServe()
+}
+
+// Stop shuts the SMTP server down without waiting for in-flight sessions.
+func (s *Server) Stop() error {
+	return s.server.Close()
+}
+
+// backend implements gosmtp.Backend, creating one session per connection.
+type backend struct {
+	cfg Config
+}
+
+func (b *backend) NewSession(_ *gosmtp.Conn) (gosmtp.Session, error) {
+	return &session{cfg: b.cfg}, nil
+}
+
+// session implements gosmtp.Session for a single SMTP conversation.
+type session struct {
+	cfg  Config
+	from string
+	to   string
+}
+
+func (s *session) Mail(from string, _ *gosmtp.MailOptions) error {
+	s.from = from
+	return nil
+}
+
+func (s *session) Rcpt(to string, _ *gosmtp.RcptOptions) error {
+	if s.cfg.RecipientPattern != nil && !s.cfg.RecipientPattern.MatchString(to) {
+		return &gosmtp.SMTPError{
+			Code:         550,
+			EnhancedCode: gosmtp.EnhancedCode{5, 1, 1},
+			Message:      "recipient not accepted",
+		}
+	}
+	s.to = to
+	return nil
+}
+
+func (s *session) Data(r io.Reader) error {
+	msg, err := ParseMessage(s.from, s.to, r)
+	if err != nil {
+		log.Printf("Failed to parse inbound message from %s: %v", s.from, err)
+		return &gosmtp.SMTPError{
+			Code:         554,
+			EnhancedCode: gosmtp.EnhancedCode{5, 6, 0},
+			Message:      "malformed message",
+		}
+	}
+
+	if s.cfg.WebhookURL == "" {
+		return nil
+	}
+	if err := DeliverWebhook(s.cfg.WebhookURL, s.cfg.WebhookSecret, msg); err != nil {
+		log.Printf("Failed to deliver inbound webhook for message from %s: %v", s.from, err)
+	}
+	return nil
+}
+
+func (s *session) Reset() {
+	s.from = ""
+	s.to = ""
+}
+
+func (s *session) Logout() error {
+	return nil
+}
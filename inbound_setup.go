@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/thanksduck/emailService/inbound"
+)
+
+// startInboundServer wires up the inbound mail subsystem from environment
+// variables and starts it in the background if INBOUND_SMTP_ADDR is set. It
+// runs independently of the outbound EmailService.
+func startInboundServer() *inbound.Server {
+	addr := os.Getenv("INBOUND_SMTP_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	cfg := inbound.Config{
+		ListenAddr:    addr,
+		Domain:        os.Getenv("INBOUND_DOMAIN"),
+		WebhookURL:    os.Getenv("INBOUND_WEBHOOK_URL"),
+		WebhookSecret: os.Getenv("INBOUND_WEBHOOK_SECRET"),
+	}
+
+	if pattern := os.Getenv("INBOUND_RECIPIENT_PATTERN"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			log.Fatalf("Invalid INBOUND_RECIPIENT_PATTERN: %v", err)
+		}
+		cfg.RecipientPattern = re
+	}
+
+	server := inbound.NewServer(cfg)
+	go func() {
+		if err := server.Start(); err != nil {
+			log.Printf("Inbound SMTP server stopped: %v", err)
+		}
+	}()
+
+	return server
+}
+
+// startIMAPPoller wires up the IMAP-polling alternative to startInboundServer
+// from environment variables, starting it in the background if IMAP_ADDR is
+// set. Both inbound paths can run at once if both are configured.
+func startIMAPPoller() *inbound.IMAPPoller {
+	addr := os.Getenv("IMAP_ADDR")
+	if addr == "" {
+		return nil
+	}
+
+	cfg := inbound.IMAPConfig{
+		Addr:          addr,
+		Username:      os.Getenv("IMAP_USERNAME"),
+		Password:      os.Getenv("IMAP_PASSWORD"),
+		Mailbox:       os.Getenv("IMAP_MAILBOX"),
+		WebhookURL:    os.Getenv("INBOUND_WEBHOOK_URL"),
+		WebhookSecret: os.Getenv("INBOUND_WEBHOOK_SECRET"),
+	}
+
+	if interval := os.Getenv("IMAP_POLL_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatalf("Invalid IMAP_POLL_INTERVAL: %v", err)
+		}
+		cfg.PollInterval = d
+	}
+
+	poller := inbound.NewIMAPPoller(cfg)
+	go func() {
+		if err := poller.Start(); err != nil {
+			log.Printf("IMAP poller stopped: %v", err)
+		}
+	}()
+
+	return poller
+}
@@ -4,15 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"net/smtp"
+	"net/mail"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/thanksduck/emailService/envcheck"
 )
@@ -24,13 +25,36 @@ type EmailTemplate struct {
 
 type EmailData struct {
 	To           string
+	From         string
 	Subject      string
 	Body         string
+	TextBody     string
+	Attachments  []Attachment
 	Data         map[string]interface{}
 	SMTPServer   string
 	SMTPPort     int
 	SMTPUsername string
 	SMTPPassword string
+
+	// Transport and the fields below select and configure the delivery
+	// backend; see SMTPProfile for what each means. Transport empty falls
+	// back to EMAIL_TRANSPORT, then TransportSMTP.
+	Transport    string
+	APIKey       string
+	Domain       string
+	Region       string
+	SendmailPath string
+
+	// DKIMPrivateKeyPath, DKIMSelector, DKIMDomain and ReturnPath mirror the
+	// matching SMTPProfile fields; see there for what each means.
+	DKIMPrivateKeyPath string
+	DKIMSelector       string
+	DKIMDomain         string
+	ReturnPath         string
+
+	// ProviderMessageID is filled in after a successful send so bounce and
+	// complaint webhooks can correlate back to this job.
+	ProviderMessageID string
 }
 
 type EmailService struct {
@@ -41,11 +65,35 @@ type EmailService struct {
 	smtpPass     string
 	senderEmail  string
 	templatesDir string
-	emailQueue   chan EmailData
+	queue        *QueueStore
+	jobs         chan QueueJob
 	workerCount  int
+	pollInterval time.Duration
 	wg           sync.WaitGroup
+	dispatcherWG sync.WaitGroup
 	ctx          context.Context
 	cancel       context.CancelFunc
+
+	// transports caches one Transport per distinct provider configuration
+	// (see transportCacheKey), so repeated sends reuse a client instead of
+	// rebuilding one - and, for SES, reloading the AWS credential chain -
+	// on every attempt.
+	transports sync.Map
+}
+
+// transportFor resolves (and caches) the Transport for data.
+func (s *EmailService) transportFor(data EmailData) (Transport, error) {
+	key := transportCacheKey(data)
+	if t, ok := s.transports.Load(key); ok {
+		return t.(Transport), nil
+	}
+
+	t, err := transportFor(data)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := s.transports.LoadOrStore(key, t)
+	return actual.(Transport), nil
 }
 
 type PlaceholderValue struct {
@@ -59,16 +107,26 @@ type SendEmailRequest struct {
 	Subject         string             `json:"subject"`
 	Template        string             `json:"template"`
 	PlaceholderData []PlaceholderValue `json:"placeholders"`
-	// SMTP credentials
-	SMTPServer   string `json:"smtp_server,omitempty"`
-	SMTPPort     int    `json:"smtp_port,omitempty"`
-	SMTPUsername string `json:"smtp_username,omitempty"`
-	SMTPPassword string `json:"smtp_password,omitempty"`
+	// Plaintext fallback; auto-generated from the rendered HTML if omitted.
+	TextBody string `json:"text_body,omitempty"`
+	// Attachments and inline (CID-referenced) images.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// From overrides the service's default sender address; must be on the
+	// authenticated tenant's sender allowlist.
+	From string `json:"from,omitempty"`
+	// ProfileID selects one of the authenticated tenant's registered SMTP
+	// profiles instead of accepting raw credentials from the caller.
+	ProfileID string `json:"profile_id,omitempty"`
 }
 
 func NewEmailService(templatesDir string) *EmailService {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	queue, err := NewQueueStore(queueStorePath())
+	if err != nil {
+		log.Fatalf("Failed to open delivery queue: %v", err)
+	}
+
 	service := &EmailService{
 		templates:    make(map[string]*template.Template),
 		smtpHost:     os.Getenv("SMTP_HOST"),
@@ -77,14 +135,17 @@ func NewEmailService(templatesDir string) *EmailService {
 		smtpPass:     os.Getenv("SMTP_PASS"),
 		senderEmail:  os.Getenv("SENDER_EMAIL"),
 		templatesDir: templatesDir,
-		emailQueue:   make(chan EmailData, 100),
+		queue:        queue,
+		jobs:         make(chan QueueJob, 100),
 		workerCount:  5,
+		pollInterval: 5 * time.Second,
 		ctx:          ctx,
 		cancel:       cancel,
 	}
 
 	service.loadTemplates()
 	service.startWorkers()
+	service.startDispatcher()
 
 	return service
 }
@@ -117,68 +178,191 @@ func (s *EmailService) startWorkers() {
 	}
 }
 
+// worker drains s.jobs until it is closed, so that jobs already dispatched
+// before a shutdown are still attempted instead of discarded mid-flight.
 func (s *EmailService) worker(id int) {
 	defer s.wg.Done()
 
 	log.Printf("Email worker %d started", id)
 
-	for {
-		select {
-		case email, ok := <-s.emailQueue:
-			if !ok {
-				log.Printf("Email worker %d stopping: queue closed", id)
+	for job := range s.jobs {
+		s.attemptDelivery(job)
+	}
+
+	log.Printf("Email worker %d stopping: queue closed", id)
+}
+
+// attemptDelivery sends a single queued job, rescheduling it with backoff on
+// transient failure or moving it to the dead-letter bucket on permanent
+// failure or attempt exhaustion.
+func (s *EmailService) attemptDelivery(job QueueJob) {
+	providerMessageID, err := s.sendEmail(job.Email)
+	if err == nil {
+		if markErr := s.queue.MarkSent(job, providerMessageID); markErr != nil {
+			log.Printf("Failed to record sent job %s: %v", job.ID, markErr)
+		}
+		return
+	}
+
+	log.Printf("Failed to send email (job %s, attempt %d): %v", job.ID, job.Attempts+1, err)
+
+	if isPermanentFailure(err) || job.Attempts+1 >= job.MaxAttempts {
+		if dlErr := s.queue.DeadLetter(job, err); dlErr != nil {
+			log.Printf("Failed to dead-letter job %s: %v", job.ID, dlErr)
+		}
+		return
+	}
+
+	if reErr := s.queue.Reschedule(job, err); reErr != nil {
+		log.Printf("Failed to reschedule job %s: %v", job.ID, reErr)
+	}
+}
+
+// startDispatcher periodically pulls due jobs from the durable queue and
+// feeds them to the worker pool.
+func (s *EmailService) startDispatcher() {
+	s.dispatcherWG.Add(1)
+	go func() {
+		defer s.dispatcherWG.Done()
+		defer close(s.jobs)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.dispatchDueJobs()
+			case <-s.ctx.Done():
 				return
 			}
-			if err := s.sendEmail(email); err != nil {
-				log.Printf("Failed to send email: %v", err)
-			}
-		case <-s.ctx.Done():
-			log.Printf("Email worker %d stopping: context cancelled", id)
-			return
 		}
+	}()
+}
+
+func (s *EmailService) dispatchDueJobs() {
+	due, err := s.queue.DueJobs(s.workerCount)
+	if err != nil {
+		log.Printf("Failed to fetch due jobs: %v", err)
+		return
+	}
+	for _, job := range due {
+		s.jobs <- job
 	}
 }
 
-func (s *EmailService) sendEmail(data EmailData) error {
-	auth := smtp.PlainAuth("", s.smtpUser, s.smtpPass, s.smtpHost)
-	addr := fmt.Sprintf("%s:%s", s.smtpHost, s.smtpPort)
+// sendEmail builds the MIME message and hands it to the Transport selected
+// by data (see transportFor), returning the provider message ID reported by
+// the transport, if any.
+func (s *EmailService) sendEmail(data EmailData) (string, error) {
+	if data.SMTPServer == "" {
+		data.SMTPServer = s.smtpHost
+		data.SMTPPort, _ = strconv.Atoi(s.smtpPort)
+		data.SMTPUsername = s.smtpUser
+		data.SMTPPassword = s.smtpPass
+	}
+	from := s.senderEmail
+	if data.From != "" {
+		from = data.From
+	}
+
+	fromDomain := domainFromAddress(from)
+	messageID, err := newMessageID(fromDomain)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate Message-Id: %w", err)
+	}
+
+	returnPath := data.ReturnPath
+	if returnPath == "" {
+		returnPath = from
+	}
 
 	headers := map[string]string{
-		"From":         s.senderEmail,
-		"To":           data.To,
-		"Subject":      data.Subject,
+		"From":         sanitizeHeaderValue(from),
+		"To":           sanitizeHeaderValue(data.To),
+		"Subject":      sanitizeHeaderValue(data.Subject),
 		"MIME-version": "1.0",
-		"Content-Type": "text/html; charset=\"UTF-8\"",
+		"Date":         timeNow().Format(time.RFC1123Z),
+		"Message-Id":   messageID,
+		"Return-Path":  returnPath,
+	}
+
+	message, err := buildMessage(headers, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to build MIME message: %w", err)
+	}
+
+	if data.DKIMPrivateKeyPath != "" {
+		domain := data.DKIMDomain
+		if domain == "" {
+			domain = fromDomain
+		}
+		selector := data.DKIMSelector
+		if selector == "" {
+			selector = defaultDKIMSelector
+		}
+		message, err = signDKIM(message, domain, selector, data.DKIMPrivateKeyPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to sign DKIM: %w", err)
+		}
+	}
+
+	transport, err := s.transportFor(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve transport: %w", err)
 	}
 
-	var message bytes.Buffer
-	for k, v := range headers {
-		message.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
+	textBody := data.TextBody
+	if textBody == "" {
+		textBody = htmlToText(data.Body)
+	}
+
+	envelope := Envelope{
+		From:        from,
+		To:          data.To,
+		Message:     message,
+		Subject:     data.Subject,
+		HTML:        data.Body,
+		Text:        textBody,
+		Attachments: data.Attachments,
+	}
+
+	providerMessageID, err := transport.Send(s.ctx, envelope)
+	if err != nil {
+		return "", err
 	}
-	message.WriteString("\r\n")
-	message.WriteString(data.Body)
 
-	to := []string{data.To}
 	fmt.Println("An email was sent to", data.To)
-	return smtp.SendMail(addr, auth, s.senderEmail, to, message.Bytes())
+	return providerMessageID, nil
 }
 
+// Stop cancels the dispatcher so no new jobs are pulled from the durable
+// queue, then waits for it to close s.jobs and for the workers to drain
+// whatever was already in flight before returning.
 func (s *EmailService) Stop() {
 	s.cancel()
-	close(s.emailQueue)
+	s.dispatcherWG.Wait()
 	s.wg.Wait()
+	if err := s.queue.Close(); err != nil {
+		log.Printf("Failed to close delivery queue: %v", err)
+	}
 }
 
-func (s *EmailService) QueueEmail(data EmailData) error {
-	select {
-	case s.emailQueue <- data:
-		return nil
-	default:
-		return errors.New("email queue is full")
-	}
+// QueueEmail persists the email to the durable queue before returning, so a
+// crash immediately afterwards does not lose the message. tenantID records
+// ownership for the queue inspection endpoints.
+func (s *EmailService) QueueEmail(data EmailData, tenantID string) error {
+	_, err := s.queue.Enqueue(data, tenantID)
+	return err
 }
 
 func (s *EmailService) handleSendEmail(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
 	query := r.URL.Query()
 
 	// Get required parameters
@@ -187,6 +371,10 @@ func (s *EmailService) handleSendEmail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Missing 'to' parameter", http.StatusBadRequest)
 		return
 	}
+	if _, err := mail.ParseAddress(to); err != nil {
+		http.Error(w, "Invalid 'to' address", http.StatusBadRequest)
+		return
+	}
 
 	slug := query.Get("slug")
 	if slug == "" {
@@ -232,6 +420,15 @@ func (s *EmailService) handleSendEmail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to render template: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if bodyBuf.Len() > maxEmailBodyBytes() {
+		http.Error(w, "Rendered email body exceeds the configured size limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !tenant.emailBucket.Allow() {
+		http.Error(w, "Daily email limit exceeded", http.StatusTooManyRequests)
+		return
+	}
 
 	// Queue the email for sending
 	emailData := EmailData{
@@ -241,7 +438,9 @@ func (s *EmailService) handleSendEmail(w http.ResponseWriter, r *http.Request) {
 		Data:    data,
 	}
 
-	if err := s.QueueEmail(emailData); err != nil {
+	err := s.QueueEmail(emailData, tenant.ID)
+	auditSend(tenant.ID, to, "", err)
+	if err != nil {
 		http.Error(w, "Failed to queue email", http.StatusInternalServerError)
 		return
 	}
@@ -252,6 +451,12 @@ func (s *EmailService) handleSendEmail(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *EmailService) handlePostSendEmail(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
 	// Parse the request body
 	var req SendEmailRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -266,11 +471,30 @@ func (s *EmailService) handlePostSendEmail(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Missing 'to' field", http.StatusBadRequest)
 		return
 	}
+	if _, err := mail.ParseAddress(req.To); err != nil {
+		http.Error(w, "Invalid 'to' address", http.StatusBadRequest)
+		return
+	}
 	if req.Template == "" {
 		http.Error(w, "Missing 'template' field", http.StatusBadRequest)
 		return
 	}
 
+	var profile SMTPProfile
+	if req.ProfileID != "" {
+		p, ok := tenant.Profiles[req.ProfileID]
+		if !ok {
+			http.Error(w, "Unknown SMTP profile", http.StatusBadRequest)
+			return
+		}
+		profile = p
+	}
+
+	if req.From != "" && !tenant.isSenderAllowed(req.From) {
+		http.Error(w, "Sender address not allowed for this tenant", http.StatusForbidden)
+		return
+	}
+
 	// Set default subject if not provided
 	if req.Subject == "" {
 		req.Subject = "Email Notification"
@@ -295,20 +519,44 @@ func (s *EmailService) handlePostSendEmail(w http.ResponseWriter, r *http.Reques
 		http.Error(w, fmt.Sprintf("Failed to render template: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if bodyBuf.Len() > maxEmailBodyBytes() {
+		http.Error(w, "Rendered email body exceeds the configured size limit", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	if !tenant.emailBucket.Allow() {
+		http.Error(w, "Daily email limit exceeded", http.StatusTooManyRequests)
+		return
+	}
 
 	// Queue the email for sending
 	emailData := EmailData{
 		To:           req.To,
+		From:         req.From,
 		Subject:      req.Subject,
 		Body:         bodyBuf.String(),
+		TextBody:     req.TextBody,
+		Attachments:  req.Attachments,
 		Data:         data,
-		SMTPServer:   req.SMTPServer,
-		SMTPPort:     req.SMTPPort,
-		SMTPUsername: req.SMTPUsername,
-		SMTPPassword: req.SMTPPassword,
+		SMTPServer:   profile.Host,
+		SMTPPort:     profile.Port,
+		SMTPUsername: profile.Username,
+		SMTPPassword: profile.Password,
+		Transport:    profile.Transport,
+		APIKey:       profile.APIKey,
+		Domain:       profile.Domain,
+		Region:       profile.Region,
+		SendmailPath: profile.SendmailPath,
+
+		DKIMPrivateKeyPath: profile.DKIMPrivateKeyPath,
+		DKIMSelector:       profile.DKIMSelector,
+		DKIMDomain:         profile.DKIMDomain,
+		ReturnPath:         profile.ReturnPath,
 	}
 
-	if err := s.QueueEmail(emailData); err != nil {
+	err = s.QueueEmail(emailData, tenant.ID)
+	auditSend(tenant.ID, req.To, req.ProfileID, err)
+	if err != nil {
 		http.Error(w, "Failed to queue email", http.StatusInternalServerError)
 		return
 	}
@@ -325,9 +573,42 @@ func main() {
 	service := NewEmailService(templatesDir)
 	defer service.Stop()
 
+	campaignStore, err := NewBoltCampaignStore(campaignStorePath())
+	if err != nil {
+		log.Fatalf("Failed to open campaign store: %v", err)
+	}
+	campaigns := NewCampaignManager(service, campaignStore)
+
+	if inboundServer := startInboundServer(); inboundServer != nil {
+		defer inboundServer.Stop()
+	}
+	if imapPoller := startIMAPPoller(); imapPoller != nil {
+		defer imapPoller.Stop()
+	}
+
+	tenants, err := LoadTenantStore(tenantStorePath())
+	if err != nil {
+		log.Fatalf("Failed to load tenant store: %v", err)
+	}
+
 	// Register both endpoints
-	http.HandleFunc("GET /send", service.handleSendEmail)
-	http.HandleFunc("POST /send", service.handlePostSendEmail)
+	http.HandleFunc("GET /send", tenants.Authenticate(service.handleSendEmail))
+	http.HandleFunc("POST /send", tenants.Authenticate(service.handlePostSendEmail))
+
+	http.HandleFunc("POST /campaign", tenants.Authenticate(campaigns.handleCreateCampaign))
+	http.HandleFunc("GET /track", campaigns.handleTrackOpen)
+	http.HandleFunc("GET /click", campaigns.handleTrackClick)
+	http.HandleFunc("GET /campaign/{id}/stats", tenants.Authenticate(campaigns.handleCampaignStats))
+
+	http.HandleFunc("GET /queue", tenants.Authenticate(service.handleListQueue))
+	http.HandleFunc("GET /queue/{id}", tenants.Authenticate(service.handleGetQueueItem))
+	http.HandleFunc("POST /queue/{id}/retry", tenants.Authenticate(service.handleRetryQueueItem))
+
+	http.HandleFunc("POST /webhooks/ses", service.handleSESWebhook)
+	http.HandleFunc("POST /webhooks/sendgrid", service.handleSendGridWebhook)
+	http.HandleFunc("POST /webhooks/mailgun", service.handleMailgunWebhook)
+
+	http.HandleFunc("GET /dkim/{domain}/dns", handleDKIMDNSRecord)
 
 	port := os.Getenv("EMAIL_SERVICE_PORT")
 	if port == "" {
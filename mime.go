@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Attachment represents a file attached to an outgoing email, either as a
+// regular attachment or, when Inline is set, as a CID-referenced image meant
+// to be embedded in the HTML body via src="cid:<CID>".
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Content     []byte `json:"content"`
+	Inline      bool   `json:"inline,omitempty"`
+	CID         string `json:"cid,omitempty"`
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// htmlToText produces a naive plaintext fallback from an HTML body when the
+// caller didn't supply one explicitly.
+func htmlToText(html string) string {
+	return strings.TrimSpace(htmlTagPattern.ReplaceAllString(html, ""))
+}
+
+// buildMessage assembles the full RFC 2045 MIME message for an email: a
+// multipart/alternative text+HTML body, wrapped in multipart/related when
+// there are inline (CID-referenced) attachments, wrapped in turn in
+// multipart/mixed when there are regular attachments. headers is mutated
+// with the resulting top-level Content-Type.
+func buildMessage(headers map[string]string, data EmailData) ([]byte, error) {
+	var inline, regular []Attachment
+	for _, a := range data.Attachments {
+		if a.Inline {
+			inline = append(inline, a)
+		} else {
+			regular = append(regular, a)
+		}
+	}
+
+	body, contentType, err := writeAlternative(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inline) > 0 {
+		body, contentType, err = wrapParts(body, contentType, inline, "related")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(regular) > 0 {
+		body, contentType, err = wrapParts(body, contentType, regular, "mixed")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers["Content-Type"] = contentType
+
+	var buf bytes.Buffer
+	for k, v := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+
+	return buf.Bytes(), nil
+}
+
+// writeAlternative builds the multipart/alternative text+HTML part of the
+// message, generating a plaintext fallback from the HTML body when the
+// caller didn't supply TextBody explicitly.
+func writeAlternative(data EmailData) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	text := data.TextBody
+	if text == "" {
+		text = htmlToText(data.Body)
+	}
+
+	if err := writeEncodedPart(w, "text/plain; charset=\"UTF-8\"", text); err != nil {
+		return nil, "", err
+	}
+	if err := writeEncodedPart(w, "text/html; charset=\"UTF-8\"", data.Body); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), fmt.Sprintf("multipart/alternative; boundary=%q", w.Boundary()), nil
+}
+
+// writeEncodedPart writes a single quoted-printable text part.
+func writeEncodedPart(w *multipart.Writer, contentType, content string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// wrapParts wraps an already-built body part inside a new multipart
+// container ("related" or "mixed") alongside one part per attachment.
+func wrapParts(body []byte, bodyContentType string, attachments []Attachment, subtype string) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", bodyContentType)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, "", err
+	}
+
+	for _, a := range attachments {
+		if err := writeAttachmentPart(w, a); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), fmt.Sprintf("multipart/%s; boundary=%q", subtype, w.Boundary()), nil
+}
+
+// sanitizeHeaderValue strips CR and LF from untrusted attachment metadata
+// (filename, CID) so it can't inject extra header lines or MIME parts into
+// the generated message.
+func sanitizeHeaderValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// writeAttachmentPart writes a single base64-encoded attachment or inline
+// image part, setting Content-Disposition and, for inline images,
+// Content-ID so the HTML body can reference it via cid:<CID>.
+func writeAttachmentPart(w *multipart.Writer, a Attachment) error {
+	filename := sanitizeHeaderValue(a.Filename)
+
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Transfer-Encoding", "base64")
+
+	if a.Inline {
+		cid := sanitizeHeaderValue(a.CID)
+		if cid == "" {
+			cid = filename
+		}
+		h.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+		h.Set("Content-ID", fmt.Sprintf("<%s>", cid))
+	} else {
+		h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	encoder := base64.NewEncoder(base64.StdEncoding, part)
+	if _, err := encoder.Write(a.Content); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestSanitizeHeaderValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain filename", "invoice.pdf", "invoice.pdf"},
+		{"embedded CRLF", "invoice.pdf\r\nBcc: attacker@evil.com", "invoice.pdfBcc: attacker@evil.com"},
+		{"bare LF", "foo\nbar", "foobar"},
+		{"bare CR", "foo\rbar", "foobar"},
+		{"empty string", "", ""},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeHeaderValue(tt.input); got != tt.want {
+			t.Errorf("%s: sanitizeHeaderValue(%q) = %q, want %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
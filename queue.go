@@ -0,0 +1,494 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// backoffSchedule is the delay before each retry attempt, indexed by
+// (attempts - 1) and clamped to the last entry once exhausted.
+var backoffSchedule = []time.Duration{
+	1 * time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	12 * time.Hour,
+}
+
+var defaultMaxAttempts = len(backoffSchedule) + 1
+
+var (
+	queuePendingBucket = []byte("pending")
+	queueDeadBucket    = []byte("dead")
+	queueSentBucket    = []byte("sent")
+	// queueMsgIndexBucket maps a provider message ID to the job ID it was
+	// delivered as, so bounce/complaint webhooks can find the sent record.
+	queueMsgIndexBucket = []byte("msg_index")
+)
+
+// Queue job statuses. Pending and dead-lettered jobs don't carry a Status
+// (their bucket already says as much); only sent jobs do, since a delivered
+// job can later be marked bounced or complained-about by a provider webhook.
+const (
+	statusDelivered = "delivered"
+	statusBounced   = "bounced"
+	statusComplaint = "complaint"
+)
+
+// QueueJob wraps an EmailData with the bookkeeping needed for durable,
+// retrying delivery.
+type QueueJob struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
+	Email       EmailData `json:"email"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Status, ProviderMessageID and BounceReason are only set once a job has
+	// been sent; see MarkSent, RecordBounce and RecordComplaint.
+	Status            string `json:"status,omitempty"`
+	ProviderMessageID string `json:"provider_message_id,omitempty"`
+	BounceReason      string `json:"bounce_reason,omitempty"`
+}
+
+// QueueStore persists pending and dead-lettered delivery jobs to disk so
+// they survive a restart.
+type QueueStore struct {
+	db *bbolt.DB
+}
+
+func NewQueueStore(path string) (*QueueStore, error) {
+	db, err := bbolt.Open(path, 0o600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open queue store: %w", err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, b := range [][]byte{queuePendingBucket, queueDeadBucket, queueSentBucket, queueMsgIndexBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to init queue store buckets: %w", err)
+	}
+
+	return &QueueStore{db: db}, nil
+}
+
+func (s *QueueStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *QueueStore) put(bucket []byte, job QueueJob) error {
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(job.ID), payload)
+	})
+}
+
+// Enqueue writes a new job to the pending bucket before returning, so a
+// crash after this call still leaves the email durably scheduled. tenantID
+// records which tenant owns the job, so the queue inspection endpoints can
+// scope results to the caller.
+func (s *QueueStore) Enqueue(data EmailData, tenantID string) (QueueJob, error) {
+	id, err := newQueueID()
+	if err != nil {
+		return QueueJob{}, err
+	}
+
+	job := QueueJob{
+		ID:          id,
+		TenantID:    tenantID,
+		Email:       data,
+		MaxAttempts: defaultMaxAttempts,
+		NextAttempt: timeNow(),
+		CreatedAt:   timeNow(),
+	}
+
+	return job, s.put(queuePendingBucket, job)
+}
+
+// DueJobs returns up to limit pending jobs whose NextAttempt has arrived,
+// removing them from the pending bucket so they aren't picked up twice.
+func (s *QueueStore) DueJobs(limit int) ([]QueueJob, error) {
+	var due []QueueJob
+	now := timeNow()
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(queuePendingBucket)
+		c := b.Cursor()
+		for k, v := c.First(); k != nil && len(due) < limit; k, v = c.Next() {
+			var job QueueJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				continue
+			}
+			if job.NextAttempt.After(now) {
+				continue
+			}
+			due = append(due, job)
+		}
+		for _, job := range due {
+			if err := b.Delete([]byte(job.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return due, err
+}
+
+// Reschedule puts a job back in the pending bucket after a transient
+// failure, with attempts incremented and NextAttempt bumped per the
+// backoff schedule.
+func (s *QueueStore) Reschedule(job QueueJob, cause error) error {
+	job.Attempts++
+	job.LastError = cause.Error()
+	job.NextAttempt = timeNow().Add(backoffDelay(job.Attempts))
+	return s.put(queuePendingBucket, job)
+}
+
+// DeadLetter moves a job to the dead-letter bucket after a permanent
+// failure or once MaxAttempts is exhausted.
+func (s *QueueStore) DeadLetter(job QueueJob, cause error) error {
+	job.Attempts++
+	job.LastError = cause.Error()
+	if err := s.put(queueDeadBucket, job); err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(queuePendingBucket).Delete([]byte(job.ID))
+	})
+}
+
+// Get looks a job up by ID in any bucket.
+func (s *QueueStore) Get(id string) (QueueJob, bool, error) {
+	var job QueueJob
+	found := false
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{queuePendingBucket, queueDeadBucket, queueSentBucket} {
+			v := tx.Bucket(bucket).Get([]byte(id))
+			if v == nil {
+				continue
+			}
+			found = true
+			return json.Unmarshal(v, &job)
+		}
+		return nil
+	})
+
+	return job, found, err
+}
+
+// List returns every job currently in the pending, dead-letter and sent
+// buckets.
+func (s *QueueStore) List() ([]QueueJob, error) {
+	var jobs []QueueJob
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for _, bucket := range [][]byte{queuePendingBucket, queueDeadBucket, queueSentBucket} {
+			c := tx.Bucket(bucket).Cursor()
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				var job QueueJob
+				if err := json.Unmarshal(v, &job); err != nil {
+					continue
+				}
+				jobs = append(jobs, job)
+			}
+		}
+		return nil
+	})
+
+	return jobs, err
+}
+
+// MarkSent records a successfully delivered job in the sent bucket. When the
+// transport reported a provider message ID, it's indexed so a later
+// bounce/complaint webhook can find this job again.
+func (s *QueueStore) MarkSent(job QueueJob, providerMessageID string) error {
+	job.Status = statusDelivered
+	job.ProviderMessageID = providerMessageID
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(queueSentBucket).Put([]byte(job.ID), payload); err != nil {
+			return err
+		}
+		if providerMessageID != "" {
+			if err := tx.Bucket(queueMsgIndexBucket).Put([]byte(providerMessageID), []byte(job.ID)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordDeliveryEvent looks a sent job up by its provider message ID and
+// updates its status, used by RecordBounce and RecordComplaint.
+func (s *QueueStore) recordDeliveryEvent(providerMessageID, status, reason string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		jobID := tx.Bucket(queueMsgIndexBucket).Get([]byte(providerMessageID))
+		if jobID == nil {
+			return fmt.Errorf("no sent job found for provider message id %q", providerMessageID)
+		}
+
+		sent := tx.Bucket(queueSentBucket)
+		v := sent.Get(jobID)
+		if v == nil {
+			return fmt.Errorf("provider message id %q indexed but job %s missing", providerMessageID, jobID)
+		}
+
+		var job QueueJob
+		if err := json.Unmarshal(v, &job); err != nil {
+			return err
+		}
+		job.Status = status
+		job.BounceReason = reason
+
+		payload, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		return sent.Put(jobID, payload)
+	})
+}
+
+// RecordBounce marks the sent job behind providerMessageID as bounced, as
+// reported by a provider's webhook.
+func (s *QueueStore) RecordBounce(providerMessageID, reason string) error {
+	return s.recordDeliveryEvent(providerMessageID, statusBounced, reason)
+}
+
+// RecordComplaint marks the sent job behind providerMessageID as a spam
+// complaint, as reported by a provider's webhook.
+func (s *QueueStore) RecordComplaint(providerMessageID, reason string) error {
+	return s.recordDeliveryEvent(providerMessageID, statusComplaint, reason)
+}
+
+// Retry moves a dead-lettered job back to pending, ready to be picked up
+// immediately, resetting its attempt count.
+func (s *QueueStore) Retry(id string) (QueueJob, error) {
+	var job QueueJob
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(queueDeadBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &job)
+	})
+	if err != nil {
+		return QueueJob{}, err
+	}
+	if !found {
+		return QueueJob{}, errors.New("queue job not found")
+	}
+
+	job.Attempts = 0
+	job.LastError = ""
+	job.NextAttempt = timeNow()
+
+	if err := s.put(queuePendingBucket, job); err != nil {
+		return QueueJob{}, err
+	}
+	return job, s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(queueDeadBucket).Delete([]byte(id))
+	})
+}
+
+func backoffDelay(attempts int) time.Duration {
+	idx := attempts - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(backoffSchedule) {
+		idx = len(backoffSchedule) - 1
+	}
+	return backoffSchedule[idx]
+}
+
+// isPermanentFailure reports whether an SMTP error should go straight to
+// the dead-letter bucket instead of being retried. 5xx SMTP replies are
+// permanent; everything else (network errors, 4xx replies) is treated as
+// transient.
+func isPermanentFailure(err error) bool {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return protoErr.Code >= 500 && protoErr.Code < 600
+	}
+	return false
+}
+
+func newQueueID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// timeNow exists so queue scheduling has a single seam; it is always
+// time.Now in production.
+func timeNow() time.Time {
+	return time.Now()
+}
+
+// redactedEmailData is the subset of EmailData safe to return over the
+// queue inspection endpoints: no SMTP/provider credentials or DKIM key
+// material.
+type redactedEmailData struct {
+	To          string                 `json:"to"`
+	From        string                 `json:"from,omitempty"`
+	Subject     string                 `json:"subject"`
+	Body        string                 `json:"body"`
+	TextBody    string                 `json:"text_body,omitempty"`
+	Attachments []Attachment           `json:"attachments,omitempty"`
+	Data        map[string]interface{} `json:"data,omitempty"`
+	Transport   string                 `json:"transport,omitempty"`
+}
+
+// redactedQueueJob is a QueueJob with its EmailData swapped for the
+// credential-free redactedEmailData.
+type redactedQueueJob struct {
+	ID                string            `json:"id"`
+	Email             redactedEmailData `json:"email"`
+	Attempts          int               `json:"attempts"`
+	MaxAttempts       int               `json:"max_attempts"`
+	NextAttempt       time.Time         `json:"next_attempt"`
+	LastError         string            `json:"last_error,omitempty"`
+	CreatedAt         time.Time         `json:"created_at"`
+	Status            string            `json:"status,omitempty"`
+	ProviderMessageID string            `json:"provider_message_id,omitempty"`
+	BounceReason      string            `json:"bounce_reason,omitempty"`
+}
+
+func redactJob(job QueueJob) redactedQueueJob {
+	return redactedQueueJob{
+		ID: job.ID,
+		Email: redactedEmailData{
+			To:          job.Email.To,
+			From:        job.Email.From,
+			Subject:     job.Email.Subject,
+			Body:        job.Email.Body,
+			TextBody:    job.Email.TextBody,
+			Attachments: job.Email.Attachments,
+			Data:        job.Email.Data,
+			Transport:   job.Email.Transport,
+		},
+		Attempts:          job.Attempts,
+		MaxAttempts:       job.MaxAttempts,
+		NextAttempt:       job.NextAttempt,
+		LastError:         job.LastError,
+		CreatedAt:         job.CreatedAt,
+		Status:            job.Status,
+		ProviderMessageID: job.ProviderMessageID,
+		BounceReason:      job.BounceReason,
+	}
+}
+
+// handleListQueue returns the calling tenant's own queue jobs. Registered
+// behind tenants.Authenticate.
+func (s *EmailService) handleListQueue(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
+	jobs, err := s.queue.List()
+	if err != nil {
+		http.Error(w, "Failed to list queue", http.StatusInternalServerError)
+		return
+	}
+
+	redacted := make([]redactedQueueJob, 0, len(jobs))
+	for _, job := range jobs {
+		if job.TenantID != tenant.ID {
+			continue
+		}
+		redacted = append(redacted, redactJob(job))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redacted)
+}
+
+// handleGetQueueItem returns a single queue job, 404ing if it doesn't exist
+// or belongs to a different tenant (so existence isn't leaked either way).
+// Registered behind tenants.Authenticate.
+func (s *EmailService) handleGetQueueItem(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
+	job, found, err := s.queue.Get(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Failed to load queue job", http.StatusInternalServerError)
+		return
+	}
+	if !found || job.TenantID != tenant.ID {
+		http.Error(w, "Queue job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactJob(job))
+}
+
+// handleRetryQueueItem re-queues a dead-lettered job, refusing to touch one
+// owned by a different tenant. Registered behind tenants.Authenticate.
+func (s *EmailService) handleRetryQueueItem(w http.ResponseWriter, r *http.Request) {
+	tenant, ok := tenantFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Missing tenant context", http.StatusUnauthorized)
+		return
+	}
+
+	existing, found, err := s.queue.Get(r.PathValue("id"))
+	if err != nil || !found || existing.TenantID != tenant.ID {
+		http.Error(w, "Queue job not found", http.StatusNotFound)
+		return
+	}
+
+	job, err := s.queue.Retry(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Queue job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redactJob(job))
+}
+
+func queueStorePath() string {
+	if path := os.Getenv("QUEUE_DB_PATH"); path != "" {
+		return path
+	}
+	return "./queue.db"
+}
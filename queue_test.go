@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: backoffSchedule[0]},
+		{attempts: 1, want: backoffSchedule[0]},
+		{attempts: 2, want: backoffSchedule[1]},
+		{attempts: len(backoffSchedule), want: backoffSchedule[len(backoffSchedule)-1]},
+		{attempts: len(backoffSchedule) + 10, want: backoffSchedule[len(backoffSchedule)-1]},
+	}
+
+	for _, tt := range tests {
+		if got := backoffDelay(tt.attempts); got != tt.want {
+			t.Errorf("backoffDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestIsPermanentFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"5xx is permanent", &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, true},
+		{"4xx is transient", &textproto.Error{Code: 421, Msg: "try again later"}, false},
+		{"non-protocol error is transient", errors.New("connection reset"), false},
+		{"wrapped 5xx is permanent", wrapErr(&textproto.Error{Code: 553, Msg: "bad recipient"}), true},
+	}
+
+	for _, tt := range tests {
+		if got := isPermanentFailure(tt.err); got != tt.want {
+			t.Errorf("%s: isPermanentFailure() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func wrapErr(err error) error {
+	return errors.Join(err)
+}
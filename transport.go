@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/smtp"
+	"os"
+	"os/exec"
+)
+
+// Envelope is the outbound message handed to a Transport. Message is the
+// fully-assembled, possibly DKIM-signed raw MIME message, which is all
+// transports with a raw-MIME upload path (SMTP, sendmail, SES, Mailgun)
+// need. Subject/HTML/Text/Attachments are the same email decomposed for
+// transports like SendGrid whose API has no raw-MIME endpoint and expects
+// structured content instead.
+type Envelope struct {
+	From    string
+	To      string
+	Message []byte
+
+	Subject     string
+	HTML        string
+	Text        string
+	Attachments []Attachment
+}
+
+// Transport delivers an already-built Envelope through some outbound
+// channel. It returns the provider's message ID, if the channel assigns
+// one, so a later bounce/complaint webhook can correlate back to the
+// originating queue job via QueueStore.RecordBounce/RecordComplaint.
+type Transport interface {
+	Send(ctx context.Context, env Envelope) (providerMessageID string, err error)
+}
+
+// Transport kind identifiers, selected per-profile (SMTPProfile.Transport)
+// or globally via the EMAIL_TRANSPORT environment variable.
+const (
+	TransportSMTP     = "smtp"
+	TransportSES      = "ses"
+	TransportSendGrid = "sendgrid"
+	TransportMailgun  = "mailgun"
+	TransportSendmail = "sendmail"
+)
+
+// resolveTransportKind picks the transport kind for data: its own Transport
+// field if set, else EMAIL_TRANSPORT, else plain net/smtp.
+func resolveTransportKind(data EmailData) string {
+	kind := data.Transport
+	if kind == "" {
+		kind = os.Getenv("EMAIL_TRANSPORT")
+	}
+	if kind == "" {
+		kind = TransportSMTP
+	}
+	return kind
+}
+
+// transportCacheKey identifies the distinct provider client data would
+// resolve to, so callers can cache and reuse one Transport per distinct
+// configuration instead of rebuilding one (and, for SES, reloading the AWS
+// credential chain) on every send.
+func transportCacheKey(data EmailData) string {
+	kind := resolveTransportKind(data)
+	switch kind {
+	case TransportSMTP:
+		return fmt.Sprintf("%s|%s|%d|%s|%s", kind, data.SMTPServer, data.SMTPPort, data.SMTPUsername, data.SMTPPassword)
+	case TransportSendmail:
+		path := data.SendmailPath
+		if path == "" {
+			path = "/usr/sbin/sendmail"
+		}
+		return fmt.Sprintf("%s|%s", kind, path)
+	case TransportSES:
+		return fmt.Sprintf("%s|%s", kind, data.Region)
+	case TransportSendGrid:
+		return fmt.Sprintf("%s|%s", kind, data.APIKey)
+	case TransportMailgun:
+		return fmt.Sprintf("%s|%s|%s", kind, data.APIKey, data.Domain)
+	default:
+		return kind
+	}
+}
+
+// transportFor resolves the Transport to use for data: its own Transport
+// field if set, else EMAIL_TRANSPORT, else plain net/smtp.
+func transportFor(data EmailData) (Transport, error) {
+	kind := resolveTransportKind(data)
+
+	switch kind {
+	case TransportSMTP:
+		return &smtpTransport{
+			host: data.SMTPServer,
+			port: data.SMTPPort,
+			user: data.SMTPUsername,
+			pass: data.SMTPPassword,
+		}, nil
+	case TransportSendmail:
+		path := data.SendmailPath
+		if path == "" {
+			path = "/usr/sbin/sendmail"
+		}
+		return &sendmailTransport{path: path}, nil
+	case TransportSES:
+		return newSESTransport(data.Region)
+	case TransportSendGrid:
+		if data.APIKey == "" {
+			return nil, fmt.Errorf("sendgrid transport requires an api key")
+		}
+		return &sendGridTransport{apiKey: data.APIKey}, nil
+	case TransportMailgun:
+		if data.APIKey == "" || data.Domain == "" {
+			return nil, fmt.Errorf("mailgun transport requires an api key and domain")
+		}
+		return &mailgunTransport{apiKey: data.APIKey, domain: data.Domain}, nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", kind)
+	}
+}
+
+// smtpTransport is the original net/smtp-based delivery path. net/smtp
+// doesn't expose a message ID, so it always returns "".
+type smtpTransport struct {
+	host       string
+	port       int
+	user, pass string
+}
+
+func (t *smtpTransport) Send(_ context.Context, env Envelope) (string, error) {
+	addr := fmt.Sprintf("%s:%d", t.host, t.port)
+	auth := smtp.PlainAuth("", t.user, t.pass, t.host)
+	return "", smtp.SendMail(addr, auth, env.From, []string{env.To}, env.Message)
+}
+
+// sendmailTransport shells out to a local sendmail-compatible binary,
+// writing the message to its stdin. Like smtpTransport, it has no message
+// ID to report.
+type sendmailTransport struct {
+	path string
+}
+
+func (t *sendmailTransport) Send(ctx context.Context, env Envelope) (string, error) {
+	cmd := exec.CommandContext(ctx, t.path, "-i", "-f", env.From, env.To)
+	cmd.Stdin = bytes.NewReader(env.Message)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("sendmail: %w: %s", err, stderr.String())
+	}
+	return "", nil
+}
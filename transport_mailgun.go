@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+const mailgunAPIBase = "https://api.mailgun.net/v3"
+
+// mailgunTransport sends through Mailgun's HTTP API using its raw MIME
+// upload endpoint (POST /v3/{domain}/messages.mime), so the Envelope's
+// already-built message goes through unmodified.
+type mailgunTransport struct {
+	apiKey string
+	domain string
+}
+
+type mailgunSendResponse struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+func (t *mailgunTransport) Send(ctx context.Context, env Envelope) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	if err := w.WriteField("to", env.To); err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+	if err := w.WriteField("from", env.From); err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+
+	part, err := w.CreateFormFile("message", "message.mime")
+	if err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+	if _, err := part.Write(env.Message); err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/messages.mime", mailgunAPIBase, t.domain)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return "", fmt.Errorf("mailgun: %w", err)
+	}
+	req.SetBasicAuth("api", t.apiKey)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("mailgun: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("mailgun: failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("mailgun: unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var parsed mailgunSendResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", fmt.Errorf("mailgun: failed to parse response: %w", err)
+	}
+
+	return parsed.ID, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const sendGridSendURL = "https://api.sendgrid.com/v3/mail/send"
+
+// sendGridTransport sends through SendGrid's v3 Mail Send API. Unlike SES
+// and Mailgun, that API has no raw-MIME endpoint, so it's built from the
+// Envelope's decomposed Subject/HTML/Text/Attachments rather than the
+// pre-assembled Envelope.Message.
+type sendGridTransport struct {
+	apiKey string
+}
+
+type sendGridMailRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Filename    string `json:"filename"`
+	Type        string `json:"type,omitempty"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+func (t *sendGridTransport) Send(ctx context.Context, env Envelope) (string, error) {
+	var content []sendGridContent
+	if env.Text != "" {
+		content = append(content, sendGridContent{Type: "text/plain", Value: env.Text})
+	}
+	if env.HTML != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: env.HTML})
+	}
+	if len(content) == 0 {
+		return "", fmt.Errorf("sendgrid: message has neither a text nor an html body")
+	}
+
+	body := sendGridMailRequest{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: env.To}}}},
+		From:             sendGridAddress{Email: env.From},
+		Subject:          env.Subject,
+		Content:          content,
+		Attachments:      sendGridAttachments(env.Attachments),
+	}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("sendgrid: failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridSendURL, bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("sendgrid: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("sendgrid: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("sendgrid: unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+
+	// SendGrid returns the message ID in X-Message-Id, not the response body.
+	return resp.Header.Get("X-Message-Id"), nil
+}
+
+// sendGridAttachments converts Attachments into SendGrid's base64-content
+// attachment shape, marking Inline attachments as inline with their CID.
+func sendGridAttachments(attachments []Attachment) []sendGridAttachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	out := make([]sendGridAttachment, 0, len(attachments))
+	for _, a := range attachments {
+		sga := sendGridAttachment{
+			Content:  base64.StdEncoding.EncodeToString(a.Content),
+			Filename: a.Filename,
+			Type:     a.ContentType,
+		}
+		if a.Inline {
+			sga.Disposition = "inline"
+			sga.ContentID = a.CID
+			if sga.ContentID == "" {
+				sga.ContentID = a.Filename
+			}
+		} else {
+			sga.Disposition = "attachment"
+		}
+		out = append(out, sga)
+	}
+	return out
+}
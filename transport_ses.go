@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// sesTransport sends raw MIME messages through the AWS SES v2 API, picking
+// up credentials from the standard AWS credential chain (env vars, shared
+// config, instance/task role).
+type sesTransport struct {
+	client *sesv2.Client
+}
+
+// newSESTransport loads the default AWS config for region and builds a
+// client. region overrides AWS_REGION/the shared config when set.
+func newSESTransport(region string) (*sesTransport, error) {
+	ctx := context.Background()
+
+	var opts []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for SES: %w", err)
+	}
+
+	return &sesTransport{client: sesv2.NewFromConfig(cfg)}, nil
+}
+
+func (t *sesTransport) Send(ctx context.Context, env Envelope) (string, error) {
+	out, err := t.client.SendEmail(ctx, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(env.From),
+		Destination:      &types.Destination{ToAddresses: []string{env.To}},
+		Content: &types.EmailContent{
+			Raw: &types.RawMessage{Data: env.Message},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("ses: %w", err)
+	}
+
+	return aws.ToString(out.MessageId), nil
+}
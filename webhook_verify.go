@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// sesSigningCertHostPattern matches the hostnames AWS actually serves SNS
+// signing certificates from. A plain ".amazonaws.com" suffix check also
+// accepts attacker-controlled names like "<attacker-bucket>.s3.amazonaws.com",
+// which would let a forged SigningCertURL point at a cert the attacker
+// controls.
+var sesSigningCertHostPattern = regexp.MustCompile(`^sns\.[a-zA-Z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// Each provider signs its delivery webhooks differently, so without
+// verification any caller who guesses a message ID can forge a bounce or
+// complaint and corrupt another tenant's queue status. These helpers verify
+// the corresponding signature before a handler trusts the payload.
+
+// sendGridWebhookPublicKey returns the base64-encoded Ed25519 public key
+// SendGrid's "Signed Event Webhook" setting was configured with, from
+// SENDGRID_WEBHOOK_PUBLIC_KEY. Verification is skipped (with a warning) when
+// it's unset, so existing deployments aren't broken by this check.
+func sendGridWebhookPublicKey() string {
+	return strings.TrimSpace(os.Getenv("SENDGRID_WEBHOOK_PUBLIC_KEY"))
+}
+
+// mailgunWebhookSigningKey returns the HTTP webhook signing key from the
+// Mailgun dashboard, via MAILGUN_WEBHOOK_SIGNING_KEY.
+func mailgunWebhookSigningKey() string {
+	return strings.TrimSpace(os.Getenv("MAILGUN_WEBHOOK_SIGNING_KEY"))
+}
+
+// verifySendGridSignature checks the Ed25519 signature SendGrid attaches to
+// signed event webhook deliveries, covering the timestamp concatenated with
+// the raw request body. See SendGrid's "Getting Started with the Event
+// Webhook Security Features".
+func verifySendGridSignature(r *http.Request, body []byte) error {
+	key := sendGridWebhookPublicKey()
+	if key == "" {
+		log.Printf("SendGrid webhook: SENDGRID_WEBHOOK_PUBLIC_KEY is unset, skipping signature verification")
+		return nil
+	}
+
+	pubKeyBytes, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("sendgrid: invalid SENDGRID_WEBHOOK_PUBLIC_KEY: %w", err)
+	}
+	if len(pubKeyBytes) != ed25519.PublicKeySize {
+		return fmt.Errorf("sendgrid: SENDGRID_WEBHOOK_PUBLIC_KEY is not an ed25519 public key")
+	}
+
+	sigHeader := r.Header.Get("X-Twilio-Email-Event-Webhook-Signature")
+	tsHeader := r.Header.Get("X-Twilio-Email-Event-Webhook-Timestamp")
+	if sigHeader == "" || tsHeader == "" {
+		return fmt.Errorf("sendgrid: missing signature headers")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigHeader)
+	if err != nil {
+		return fmt.Errorf("sendgrid: invalid signature encoding: %w", err)
+	}
+
+	signedPayload := append([]byte(tsHeader), body...)
+	if !ed25519.Verify(ed25519.PublicKey(pubKeyBytes), signedPayload, sig) {
+		return fmt.Errorf("sendgrid: signature verification failed")
+	}
+	return nil
+}
+
+// verifyMailgunSignature checks Mailgun's HMAC-SHA256 webhook signature,
+// computed over timestamp+token with the account's webhook signing key. See
+// Mailgun's "Webhooks Security" docs.
+func verifyMailgunSignature(sig mailgunSignature) error {
+	key := mailgunWebhookSigningKey()
+	if key == "" {
+		return nil
+	}
+	if sig.Timestamp == "" || sig.Token == "" || sig.Signature == "" {
+		return fmt.Errorf("mailgun: missing signature fields")
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	expected := mac.Sum(nil)
+
+	got, err := hex.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("mailgun: invalid signature encoding: %w", err)
+	}
+	if !hmac.Equal(expected, got) {
+		return fmt.Errorf("mailgun: signature verification failed")
+	}
+	return nil
+}
+
+// verifySESNotification checks the RSA signature SNS attaches to every
+// delivery, fetching the signing certificate from the SigningCertURL in the
+// payload itself. The host must match AWS's documented SNS signing-cert
+// hostname pattern, and the fetched certificate must chain to a trusted
+// root, so an attacker can't point SigningCertURL at a cert of their own
+// choosing (e.g. one hosted under "<attacker-bucket>.s3.amazonaws.com"). See
+// AWS's "Verifying the Signatures of Amazon SNS Messages".
+func verifySESNotification(n sesNotification) error {
+	if n.SigningCertURL == "" || n.Signature == "" {
+		return fmt.Errorf("ses: missing SNS signature fields")
+	}
+
+	certURL, err := url.Parse(n.SigningCertURL)
+	if err != nil {
+		return fmt.Errorf("ses: invalid SigningCertURL: %w", err)
+	}
+	if certURL.Scheme != "https" || !sesSigningCertHostPattern.MatchString(strings.ToLower(certURL.Host)) {
+		return fmt.Errorf("ses: SigningCertURL %q does not match an SNS signing certificate host", n.SigningCertURL)
+	}
+
+	resp, err := http.Get(certURL.String())
+	if err != nil {
+		return fmt.Errorf("ses: failed to fetch signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	certPEM, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("ses: failed to read signing certificate: %w", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return fmt.Errorf("ses: signing certificate is not valid PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("ses: failed to parse signing certificate: %w", err)
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil || roots == nil {
+		return fmt.Errorf("ses: no trusted root pool available to verify signing certificate: %w", err)
+	}
+	verifyOpts := x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: time.Now(),
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := cert.Verify(verifyOpts); err != nil {
+		return fmt.Errorf("ses: signing certificate does not chain to a trusted root: %w", err)
+	}
+
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("ses: signing certificate has no RSA public key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(n.Signature)
+	if err != nil {
+		return fmt.Errorf("ses: invalid signature encoding: %w", err)
+	}
+
+	digest := sha1.Sum(n.canonicalize())
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA1, digest[:], sig); err != nil {
+		return fmt.Errorf("ses: signature verification failed: %w", err)
+	}
+	return nil
+}
+
+// canonicalize builds the "string to sign" SNS specifies for Notification
+// messages: each signed field name and value, in a fixed order, each
+// terminated by a newline.
+func (n sesNotification) canonicalize() []byte {
+	fields := []struct{ name, value string }{
+		{"Message", n.Message},
+		{"MessageId", n.MessageId},
+	}
+	if n.Subject != "" {
+		fields = append(fields, struct{ name, value string }{"Subject", n.Subject})
+	}
+	fields = append(fields,
+		struct{ name, value string }{"Timestamp", n.Timestamp},
+		struct{ name, value string }{"TopicArn", n.TopicArn},
+		struct{ name, value string }{"Type", n.Type},
+	)
+
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f.name)
+		b.WriteByte('\n')
+		b.WriteString(f.value)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
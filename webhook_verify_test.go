@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyMailgunSignature(t *testing.T) {
+	t.Setenv("MAILGUN_WEBHOOK_SIGNING_KEY", "super-secret-key")
+
+	sig := mailgunSignature{Timestamp: "1700000000", Token: "abc123"}
+	mac := hmac.New(sha256.New, []byte("super-secret-key"))
+	mac.Write([]byte(sig.Timestamp + sig.Token))
+	sig.Signature = hex.EncodeToString(mac.Sum(nil))
+
+	if err := verifyMailgunSignature(sig); err != nil {
+		t.Errorf("expected valid signature to verify, got %v", err)
+	}
+
+	tampered := sig
+	tampered.Token = "attacker-controlled"
+	if err := verifyMailgunSignature(tampered); err == nil {
+		t.Error("expected tampered signature to be rejected")
+	}
+}
+
+func TestVerifyMailgunSignatureSkippedWhenUnconfigured(t *testing.T) {
+	if err := verifyMailgunSignature(mailgunSignature{}); err != nil {
+		t.Errorf("expected verification to be skipped when no signing key is configured, got %v", err)
+	}
+}
+
+func TestVerifySendGridSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", base64.StdEncoding.EncodeToString(pub))
+
+	body := []byte(`[{"event":"bounce","sg_message_id":"abc"}]`)
+	timestamp := "1700000000"
+	sig := ed25519.Sign(priv, append([]byte(timestamp), body...))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/sendgrid", nil)
+	req.Header.Set("X-Twilio-Email-Event-Webhook-Signature", base64.StdEncoding.EncodeToString(sig))
+	req.Header.Set("X-Twilio-Email-Event-Webhook-Timestamp", timestamp)
+
+	if err := verifySendGridSignature(req, body); err != nil {
+		t.Errorf("expected valid signature to verify, got %v", err)
+	}
+
+	if err := verifySendGridSignature(req, []byte(`[{"event":"tampered"}]`)); err == nil {
+		t.Error("expected signature over a different body to be rejected")
+	}
+}
+
+func TestVerifySendGridSignatureMissingHeaders(t *testing.T) {
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", base64.StdEncoding.EncodeToString(make([]byte, ed25519.PublicKeySize)))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/sendgrid", nil)
+	if err := verifySendGridSignature(req, []byte("{}")); err == nil {
+		t.Error("expected missing signature headers to be rejected")
+	}
+}
+
+func TestVerifySESNotificationRejectsNonSNSHost(t *testing.T) {
+	n := sesNotification{
+		Signature:      "deadbeef",
+		SigningCertURL: "https://attacker-bucket.s3.amazonaws.com/cert.pem",
+	}
+	if err := verifySESNotification(n); err == nil {
+		t.Error("expected a non-SNS signing host to be rejected")
+	}
+}
+
+func TestVerifySESNotificationRequiresSignatureFields(t *testing.T) {
+	if err := verifySESNotification(sesNotification{}); err == nil {
+		t.Error("expected a notification with no signature fields to be rejected")
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Provider delivery webhooks: SES delivers bounce/complaint notifications
+// via SNS, SendGrid posts a batch of event objects, and Mailgun posts one
+// event per request. Each handler normalizes its provider's payload down to
+// a provider message ID and an outcome, then updates the matching sent queue
+// job via QueueStore.RecordBounce/RecordComplaint.
+
+// sesNotification is the SNS envelope SES bounce/complaint subscriptions
+// deliver. Message is itself JSON-encoded, per SNS convention. The
+// remaining fields are only used to verify the SNS signature.
+type sesNotification struct {
+	Type           string `json:"Type"`
+	Message        string `json:"Message"`
+	MessageId      string `json:"MessageId"`
+	Timestamp      string `json:"Timestamp"`
+	TopicArn       string `json:"TopicArn"`
+	Subject        string `json:"Subject"`
+	Signature      string `json:"Signature"`
+	SigningCertURL string `json:"SigningCertURL"`
+}
+
+type sesEvent struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		MessageID string `json:"messageId"`
+	} `json:"mail"`
+	Bounce struct {
+		BounceType string `json:"bounceType"`
+	} `json:"bounce"`
+	Complaint struct {
+		ComplaintFeedbackType string `json:"complaintFeedbackType"`
+	} `json:"complaint"`
+}
+
+func (s *EmailService) handleSESWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var notification sesNotification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		http.Error(w, "Invalid SNS notification", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifySESNotification(notification); err != nil {
+		log.Printf("SES webhook: rejecting notification: %v", err)
+		http.Error(w, "Invalid SNS signature", http.StatusForbidden)
+		return
+	}
+
+	if notification.Type == "SubscriptionConfirmation" {
+		log.Printf("SES webhook: received SNS subscription confirmation, ignoring (confirm manually via the SubscribeURL)")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var event sesEvent
+	if err := json.Unmarshal([]byte(notification.Message), &event); err != nil {
+		http.Error(w, "Invalid SES event payload", http.StatusBadRequest)
+		return
+	}
+
+	var recErr error
+	switch event.NotificationType {
+	case "Bounce":
+		recErr = s.queue.RecordBounce(event.Mail.MessageID, event.Bounce.BounceType)
+	case "Complaint":
+		recErr = s.queue.RecordComplaint(event.Mail.MessageID, event.Complaint.ComplaintFeedbackType)
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if recErr != nil {
+		log.Printf("SES webhook: failed to record %s for message %s: %v", event.NotificationType, event.Mail.MessageID, recErr)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// sendGridEvent is one entry of the JSON array SendGrid posts per batch.
+type sendGridEvent struct {
+	SGMessageID string `json:"sg_message_id"`
+	Event       string `json:"event"`
+	Reason      string `json:"reason"`
+}
+
+func (s *EmailService) handleSendGridWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifySendGridSignature(r, raw); err != nil {
+		log.Printf("SendGrid webhook: rejecting event: %v", err)
+		http.Error(w, "Invalid event signature", http.StatusForbidden)
+		return
+	}
+
+	var events []sendGridEvent
+	if err := json.Unmarshal(raw, &events); err != nil {
+		http.Error(w, "Invalid SendGrid event payload", http.StatusBadRequest)
+		return
+	}
+
+	for _, event := range events {
+		var recErr error
+		switch event.Event {
+		case "bounce", "dropped":
+			recErr = s.queue.RecordBounce(event.SGMessageID, event.Reason)
+		case "spamreport":
+			recErr = s.queue.RecordComplaint(event.SGMessageID, event.Reason)
+		default:
+			continue
+		}
+		if recErr != nil {
+			log.Printf("SendGrid webhook: failed to record %s for message %s: %v", event.Event, event.SGMessageID, recErr)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// mailgunWebhookPayload is the JSON body Mailgun posts for each event.
+// Signature is the HMAC token/timestamp triple Mailgun signs every webhook
+// delivery with, independent of event-data.
+type mailgunWebhookPayload struct {
+	Signature mailgunSignature `json:"signature"`
+	EventData struct {
+		Event   string `json:"event"`
+		Reason  string `json:"reason"`
+		Message struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	} `json:"event-data"`
+}
+
+type mailgunSignature struct {
+	Timestamp string `json:"timestamp"`
+	Token     string `json:"token"`
+	Signature string `json:"signature"`
+}
+
+func (s *EmailService) handleMailgunWebhook(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	var payload mailgunWebhookPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		http.Error(w, "Invalid Mailgun event payload", http.StatusBadRequest)
+		return
+	}
+
+	if err := verifyMailgunSignature(payload.Signature); err != nil {
+		log.Printf("Mailgun webhook: rejecting event: %v", err)
+		http.Error(w, "Invalid event signature", http.StatusForbidden)
+		return
+	}
+
+	messageID := "<" + payload.EventData.Message.Headers.MessageID + ">"
+
+	var recErr error
+	switch payload.EventData.Event {
+	case "failed":
+		recErr = s.queue.RecordBounce(messageID, payload.EventData.Reason)
+	case "complained":
+		recErr = s.queue.RecordComplaint(messageID, payload.EventData.Reason)
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if recErr != nil {
+		log.Printf("Mailgun webhook: failed to record %s for message %s: %v", payload.EventData.Event, messageID, recErr)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}